@@ -0,0 +1,72 @@
+package logfilewriter
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec compresses archived log files. NewWriter wraps the destination
+// archive file, Extension is appended to the archived file name.
+type Codec interface {
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	Extension() string
+}
+
+// leveledCodec is implemented by the codecs below so WithCompression can
+// apply its level argument; a custom Codec that doesn't implement it
+// simply ignores the level.
+type leveledCodec interface {
+	withLevel(level int) Codec
+}
+
+type gzipCodec struct {
+	level int
+}
+
+// GzipCodec compresses archived log files with gzip, see WithCompression.
+var GzipCodec Codec = gzipCodec{level: gzip.BestSpeed}
+
+func (c gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, c.level)
+}
+
+func (c gzipCodec) Extension() string { return ".gz" }
+
+func (c gzipCodec) withLevel(level int) Codec { c.level = level; return c }
+
+type zlibCodec struct {
+	level int
+}
+
+// ZlibCodec compresses archived log files with zlib, see WithCompression.
+var ZlibCodec Codec = zlibCodec{level: zlib.DefaultCompression}
+
+func (c zlibCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zlib.NewWriterLevel(w, c.level)
+}
+
+func (c zlibCodec) Extension() string { return ".zz" }
+
+func (c zlibCodec) withLevel(level int) Codec { c.level = level; return c }
+
+type zstdCodec struct {
+	level zstd.EncoderLevel
+}
+
+// ZstdCodec compresses archived log files with zstd, see WithCompression.
+var ZstdCodec Codec = zstdCodec{level: zstd.SpeedDefault}
+
+func (c zstdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(c.level))
+}
+
+func (c zstdCodec) Extension() string { return ".zst" }
+
+// withLevel takes level on the same 1-22 scale as the zstd command line tool.
+func (c zstdCodec) withLevel(level int) Codec {
+	c.level = zstd.EncoderLevelFromZstd(level)
+	return c
+}
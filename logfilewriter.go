@@ -1,26 +1,100 @@
 package logfilewriter
 
 import (
-	"compress/gzip"
+	"bytes"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
-	"sync/atomic"
+	"sync"
+	"syscall"
 	"time"
 )
 
-type fileWriter struct {
-	dir        string // log file dir
-	file       string // log file name, default filepath.Base(os.Args[0])
-	sizeLimit  int64  // log file size limit
-	archiveDir string // log file archive dir
-	compress   bool   // whether compress archived log file
-	rotateDays int    // auto rotate days
+// RotateInterval selects how often the log file is periodically replaced,
+// and the granularity of the archive directory layout.
+type RotateInterval int
+
+const (
+	// Daily replaces the log file at the start of every day (default).
+	Daily RotateInterval = iota
+	// Hourly replaces the log file at the start of every hour.
+	Hourly
+)
+
+// OverflowPolicy selects what happens to a Write call when the internal
+// write buffer is full.
+type OverflowPolicy int
 
-	rotating int32
-	wn       int64
-	fp       atomic.Pointer[os.File]
+const (
+	// Drop discards the write once the buffer is full (default).
+	// Write never blocks the caller.
+	Drop OverflowPolicy = iota
+	// Block makes Write wait until buffer space is available.
+	Block
+)
+
+// writeJob is what flows through fileWriter.ch. A job with a non-nil done
+// is a flush request: it carries no data and is closed once every job
+// enqueued before it has been written out. A job with a non-nil reopen is
+// a Reopen request: the result is sent back on reopen. A job with a
+// non-nil closeReq is a Close request: it is closed once the file handle
+// has been closed and the loop is about to exit.
+type writeJob struct {
+	data     []byte
+	done     chan struct{}
+	reopen   chan error
+	closeReq chan struct{}
+}
+
+// reopenGracePeriod is how long Reopen keeps the old file handle open
+// after swapping in the new one, giving any in-flight readers of the old
+// handle (e.g. something still tailing it) a window to finish.
+const reopenGracePeriod = 10 * time.Second
+
+type fileWriter struct {
+	dir            string                                // log file dir
+	file           string                                // log file name, default filepath.Base(os.Args[0])
+	sizeLimit      int64                                 // log file size limit
+	archiveDir     string                                // log file archive dir
+	codec          Codec                                 // archived log file compression codec, nil means uncompressed
+	rotateDays     int                                   // auto rotate days
+	rotateHours    int                                   // auto rotate hours, used when rotateInterval is Hourly
+	rotateInterval RotateInterval                        // how often the log file is rotated
+	maxBackups     int                                   // max number of archived log files to keep
+	maxTotalSize   int64                                 // max total size in bytes of archived log files to keep
+	maxLines       int64                                 // log file max line count limit
+	bufSize        int                                   // ch buffer size
+	overflow       OverflowPolicy                        // what to do when ch is full
+	delimiter      string                                // delimiter between base name and timestamp, default "-"
+	archivePathFn  func(base string, t time.Time) string // builds the path relative to archiveDir
+	signalReopen   bool                                  // whether to reopen fp on SIGHUP
+
+	ch      chan writeJob
+	stopped chan struct{}
+
+	// closeMu guards closed: Write/Flush/Reopen take it for reading while
+	// they enqueue a job, Close takes it for writing while it flips
+	// closed. This guarantees the closeReq job Close enqueues is always
+	// the last job in fw.ch, so a job enqueued concurrently with Close
+	// either lands before closeReq and still gets serviced, or the
+	// enqueuing call observes closed and bails out instead of enqueuing
+	// after loop has already exited.
+	closeMu sync.RWMutex
+	closed  bool
+
+	// owned exclusively by the loop goroutine, no locking needed
+	fp           *os.File
+	wn           int64
+	curLines     int64
+	closeErr     error
+	pendingOld   *os.File    // old handle from the most recent Reopen, still in its grace period
+	pendingTimer *time.Timer // closes pendingOld once reopenGracePeriod elapses
 }
 
 type Options interface {
@@ -55,32 +129,144 @@ func WithFileSizeLimit(limit int64) Options {
 }
 
 // WithArchiveDir sets the log file archive dir.
-// The log files will be archived to
-// "archiveDir/20060102/logfilename.log-20060102-150405".
+// By default the log files are archived to
+// "archiveDir/20060102/logfilename-20060102-150405", see WithArchiveLayout
+// and WithTimestampDelimiter to customize this.
 func WithArchiveDir(dir string) Options {
 	return applyFunc(func(fw *fileWriter) {
 		fw.archiveDir = dir
 	})
 }
 
-// WithCompress sets the archived log file compress to gzip format.
-// Namely the log files will be archived to
-// "archiveDir/20060102/logfilename.log-20060102-150405.gz".
-func WithCompress() Options {
+// WithArchiveLayout sets fn to build the archived file path relative to
+// archiveDir, given the log file base name and the instant it was rotated
+// at. The default builds "20060102/base-20060102-150405"; fn can return
+// any layout, e.g. "base.2006-01-02T15:04:05" for a flat archive with no
+// date subdirectory.
+func WithArchiveLayout(fn func(base string, t time.Time) string) Options {
+	return applyFunc(func(fw *fileWriter) {
+		fw.archivePathFn = fn
+	})
+}
+
+// WithTimestampDelimiter sets the delimiter placed between the log file
+// base name and its rotation timestamp, default "-".
+func WithTimestampDelimiter(delimiter string) Options {
 	return applyFunc(func(fw *fileWriter) {
-		fw.compress = true
+		fw.delimiter = delimiter
+	})
+}
+
+// WithCompression sets codec and level to compress archived log files,
+// e.g. WithCompression(GzipCodec, gzip.BestSpeed). The archived log files
+// will get codec.Extension() appended, e.g.
+// "archiveDir/20060102/logfilename-20060102-150405.gz" for GzipCodec.
+// Built-in codecs are GzipCodec, ZlibCodec and ZstdCodec; a custom Codec
+// that doesn't support levels simply ignores level.
+func WithCompression(codec Codec, level int) Options {
+	return applyFunc(func(fw *fileWriter) {
+		if lc, ok := codec.(leveledCodec); ok {
+			codec = lc.withLevel(level)
+		}
+		fw.codec = codec
 	})
 }
 
 // WithRotateDays sets the archived log files max rotate days.
+// It only takes effect when the rotate interval is Daily (the default).
 func WithRotateDays(days int) Options {
 	return applyFunc(func(fw *fileWriter) {
 		fw.rotateDays = days
 	})
 }
 
+// WithRotateHours sets the archived log files max rotate hours.
+// It only takes effect when the rotate interval is Hourly, see WithRotateInterval.
+func WithRotateHours(hours int) Options {
+	return applyFunc(func(fw *fileWriter) {
+		fw.rotateHours = hours
+	})
+}
+
+// WithMaxBackups sets the max number of archived log files to keep.
+// Once exceeded, the oldest archived files are removed first, in addition
+// to any age-based pruning from WithRotateDays/WithRotateHours.
+// Pruning runs before the file just rotated out is archived, so right
+// after a rotation up to n+1 archived files can exist.
+func WithMaxBackups(n int) Options {
+	return applyFunc(func(fw *fileWriter) {
+		fw.maxBackups = n
+	})
+}
+
+// WithMaxTotalSize sets the max total size in bytes of archived log files
+// to keep. Once exceeded, the oldest archived files are removed first, in
+// addition to any age-based pruning from WithRotateDays/WithRotateHours.
+// Pruning runs before the file just rotated out is archived, so right
+// after a rotation the total can exceed bytes by the size of that file.
+func WithMaxTotalSize(bytes int64) Options {
+	return applyFunc(func(fw *fileWriter) {
+		fw.maxTotalSize = bytes
+	})
+}
+
+// WithRotateInterval sets how often the log file is replaced: Daily (default)
+// or Hourly. When Hourly is set, the log file is replaced at the top of every
+// hour and archives are grouped under "archiveDir/2006010215/...".
+func WithRotateInterval(interval RotateInterval) Options {
+	return applyFunc(func(fw *fileWriter) {
+		fw.rotateInterval = interval
+	})
+}
+
+// WithMaxLines sets every log file max line count limit.
+// Rotation fires once the line count exceeds n, independently of
+// WithFileSizeLimit; whichever limit is reached first triggers rotation.
+func WithMaxLines(n int) Options {
+	return applyFunc(func(fw *fileWriter) {
+		fw.maxLines = int64(n)
+	})
+}
+
+// WithBufferSize sets the size of the internal write buffer, default 100.
+// Write enqueues onto this buffer; a dedicated goroutine owns the file
+// handle and drains it, so Write itself never touches the file.
+func WithBufferSize(n int) Options {
+	return applyFunc(func(fw *fileWriter) {
+		fw.bufSize = n
+	})
+}
+
+// WithOverflowPolicy sets what Write does once the buffer set by
+// WithBufferSize is full: Drop (default) discards the write, Block waits
+// for room.
+func WithOverflowPolicy(policy OverflowPolicy) Options {
+	return applyFunc(func(fw *fileWriter) {
+		fw.overflow = policy
+	})
+}
+
+// WithSignalReopen installs a SIGHUP handler that calls Reopen, the
+// standard Unix idiom for cooperating with external tools like
+// logrotate(8): the tool renames the active file out from under the
+// writer and signals the process to reopen a fresh handle at the same
+// path.
+func WithSignalReopen() Options {
+	return applyFunc(func(fw *fileWriter) {
+		fw.signalReopen = true
+	})
+}
+
+// Writer is the log file writer returned by New. Besides io.WriteCloser,
+// it exposes Flush and Reopen for callers that need them.
+type Writer interface {
+	io.WriteCloser
+	Flush() error
+	Reopen() error
+}
+
 // New make a new log file writer with options.
-func New(opts ...Options) io.WriteCloser {
+func New(opts ...Options) Writer {
 	fw := new(fileWriter)
 	for _, opt := range opts {
 		opt.apply(fw)
@@ -96,58 +282,299 @@ func New(opts ...Options) io.WriteCloser {
 		fw.file = name
 	}
 
+	if fw.bufSize <= 0 {
+		fw.bufSize = 100
+	}
+	fw.ch = make(chan writeJob, fw.bufSize)
+	fw.stopped = make(chan struct{})
+
 	os.MkdirAll(fw.dir, 0755)
-	name := filepath.Join(fw.dir, fw.file) + "-" + time.Now().Format(fileTimeLayout)
-	fp, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY, 0644)
+	flag := os.O_CREATE | os.O_WRONLY
+	if fw.signalReopen {
+		// The stable path may already hold content from a previous run
+		// that ended without an external rename (e.g. a plain restart);
+		// append to it instead of overwriting its head.
+		flag |= os.O_APPEND
+	}
+	fp, err := os.OpenFile(fw.activePath(), flag, 0644)
 	if err == nil {
-		fw.fp.Store(fp)
+		fw.fp = fp
 	} else {
-		fw.fp.Store(os.Stdout)
+		fw.fp = os.Stdout
+	}
+	go fw.loop()
+	if fw.signalReopen {
+		go fw.watchReopenSignal()
 	}
-	go fw.rotate()
-	go fw.autoReplaceFileEveryday()
 	return fw
 }
 
+// delim returns the delimiter between the log file base name and its
+// rotation timestamp, defaulting to "-".
+func (fw *fileWriter) delim() string {
+	if fw.delimiter == "" {
+		return "-"
+	}
+	return fw.delimiter
+}
+
+// activePath returns the path the currently active log file should be
+// opened at. When WithSignalReopen is set, this is always the stable
+// filepath.Join(fw.dir, fw.file) path, since logrotate(8)-style tooling
+// needs a fixed path to rename and to signal the process to reopen at;
+// the rotation timestamp is applied only when the file is rotated out,
+// see replaceAndRotate. Otherwise the timestamp is embedded up front, as
+// there is no external tool expecting a stable name to reopen.
+func (fw *fileWriter) activePath() string {
+	if fw.signalReopen {
+		return filepath.Join(fw.dir, fw.file)
+	}
+	return filepath.Join(fw.dir, fw.file) + fw.delim() + time.Now().Format(fileTimeLayout)
+}
+
 const (
 	fileTimeLayout    = "20060102-150405"
 	archiveDateLayout = "20060102"
+	archiveHourLayout = "2006010215"
 )
 
+// archiveDirLayout returns the time layout used for the default archive
+// sub-directory, matching the configured rotate interval.
+func (fw *fileWriter) archiveDirLayout() string {
+	if fw.rotateInterval == Hourly {
+		return archiveHourLayout
+	}
+	return archiveDateLayout
+}
+
+// Write enqueues b onto the internal write buffer; the actual write
+// happens later on the loop goroutine that owns the file handle. b is
+// copied, so the caller's slice may be reused once Write returns.
 func (fw *fileWriter) Write(b []byte) (int, error) {
-	if fw.sizeLimit > 0 && atomic.AddInt64(&fw.wn, int64(len(b))) > fw.sizeLimit {
-		if atomic.CompareAndSwapInt32(&fw.rotating, 0, 1) {
-			go fw.replaceAndRotate()
+	fw.closeMu.RLock()
+	defer fw.closeMu.RUnlock()
+	if fw.closed {
+		return 0, os.ErrClosed
+	}
+
+	data := make([]byte, len(b))
+	copy(data, b)
+	job := writeJob{data: data}
+
+	if fw.overflow == Block {
+		fw.ch <- job
+		return len(b), nil
+	}
+	select {
+	case fw.ch <- job:
+	default: // buffer full, drop
+	}
+	return len(b), nil
+}
+
+// Flush blocks until every write enqueued before it has been written to
+// the file.
+func (fw *fileWriter) Flush() error {
+	fw.closeMu.RLock()
+	defer fw.closeMu.RUnlock()
+	if fw.closed {
+		return os.ErrClosed
+	}
+
+	done := make(chan struct{})
+	fw.ch <- writeJob{done: done}
+	<-done
+	return nil
+}
+
+// Reopen closes the current file handle after a grace period and opens a
+// fresh one at the same path, letting the writer pick up after an
+// external tool like logrotate(8) has renamed the file out from under it.
+func (fw *fileWriter) Reopen() error {
+	fw.closeMu.RLock()
+	defer fw.closeMu.RUnlock()
+	if fw.closed {
+		return os.ErrClosed
+	}
+
+	result := make(chan error, 1)
+	fw.ch <- writeJob{reopen: result}
+	return <-result
+}
+
+// Close drains the write buffer and closes the file handle. It blocks
+// until the loop goroutine has finished processing everything already
+// enqueued.
+func (fw *fileWriter) Close() error {
+	fw.closeMu.Lock()
+	if fw.closed {
+		fw.closeMu.Unlock()
+		return nil
+	}
+	fw.closed = true
+	fw.closeMu.Unlock()
+
+	done := make(chan struct{})
+	fw.ch <- writeJob{closeReq: done}
+	<-done
+	return fw.closeErr
+}
+
+// loop owns fw.fp and is the only goroutine that touches it, the write
+// buffer, or the line/size counters; this removes the need for atomics
+// or locking around the file handle. fw.ch is never closed, so a Write or
+// Reopen racing with Close never panics on a send to a closed channel;
+// closeMu keeps such a call from enqueuing after Close's closeReq, so it
+// is either serviced before loop exits or returns os.ErrClosed.
+func (fw *fileWriter) loop() {
+	defer close(fw.stopped)
+
+	fw.rotate() // archive/prune anything left over from a previous run
+
+	timer := time.NewTimer(fw.untilNextRotate())
+	defer timer.Stop()
+
+	for {
+		select {
+		case job := <-fw.ch:
+			switch {
+			case job.closeReq != nil:
+				fw.closeErr = fw.closeFile()
+				close(job.closeReq)
+				return
+			case job.reopen != nil:
+				job.reopen <- fw.doReopen()
+			case job.done != nil:
+				close(job.done)
+			default:
+				fw.writeOut(job.data)
+			}
+		case <-timer.C:
+			fw.replaceAndRotate()
+			timer.Reset(fw.untilNextRotate())
 		}
 	}
-	return fw.fp.Load().Write(b)
 }
 
-func (fw *fileWriter) Close() (err error) {
-	fp := fw.fp.Load()
-	if fp != os.Stdout {
-		fw.fp.Store(os.Stdout)
-		err = fp.Close()
+func (fw *fileWriter) writeOut(b []byte) {
+	fw.fp.Write(b)
+
+	needRotate := false
+	if fw.sizeLimit > 0 {
+		fw.wn += int64(len(b))
+		needRotate = fw.wn > fw.sizeLimit
+	}
+	if fw.maxLines > 0 {
+		fw.curLines += int64(bytes.Count(b, []byte{'\n'}))
+		needRotate = needRotate || fw.curLines > fw.maxLines
+	}
+	if needRotate {
+		fw.replaceAndRotate()
 	}
-	return
 }
 
-func (fw *fileWriter) replaceAndRotate() {
-	defer atomic.StoreInt32(&fw.rotating, 0)
+func (fw *fileWriter) closeFile() error {
+	if fw.pendingTimer != nil {
+		fw.pendingTimer.Stop()
+		fw.pendingOld.Close()
+		fw.pendingOld, fw.pendingTimer = nil, nil
+	}
+	if fw.fp == os.Stdout {
+		return nil
+	}
+	return fw.fp.Close()
+}
+
+// doReopen runs on the loop goroutine. It opens a new handle at fw's
+// active path and swaps it in, scheduling the old handle to close after
+// reopenGracePeriod. With WithSignalReopen set, that
+// path is the stable filepath.Join(fw.dir, fw.file) path external tools
+// renamed the old file out from under, opened with O_APPEND since it may
+// already hold content from before this reopen (e.g. a prior run's
+// tail, if nothing renamed it away); without WithSignalReopen, fw.fp's
+// current path is reopened as-is.
+func (fw *fileWriter) doReopen() error {
+	if fw.fp == os.Stdout {
+		return nil
+	}
+
+	name := fw.fp.Name()
+	flag := os.O_CREATE | os.O_WRONLY
+	if fw.signalReopen {
+		name = filepath.Join(fw.dir, fw.file)
+		flag |= os.O_APPEND
+	}
+	fp, err := os.OpenFile(name, flag, 0644)
+	if err != nil {
+		return err
+	}
 
+	old := fw.fp
+	fw.fp = fp
+	fw.wn = 0
+	fw.curLines = 0
+	fw.scheduleOldClose(old)
+	return nil
+}
+
+// scheduleOldClose arranges for old to be closed after reopenGracePeriod,
+// giving any in-flight readers of the previous handle (e.g. something
+// still tailing it) a window to finish. Only one such close is ever
+// pending: a Reopen arriving before the previous grace period elapsed
+// closes that still-pending handle immediately instead of letting
+// concurrently-open descriptors pile up.
+func (fw *fileWriter) scheduleOldClose(old *os.File) {
+	if fw.pendingTimer != nil {
+		fw.pendingTimer.Stop()
+		fw.pendingOld.Close()
+	}
+	fw.pendingOld = old
+	fw.pendingTimer = time.AfterFunc(reopenGracePeriod, func() {
+		old.Close()
+	})
+}
+
+// watchReopenSignal reopens the log file on every SIGHUP, the standard
+// Unix idiom for cooperating with external log rotation tools.
+func (fw *fileWriter) watchReopenSignal() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case <-sig:
+			if err := fw.Reopen(); err != nil {
+				fmt.Fprintf(os.Stderr, "logfilewriter: reopen on SIGHUP failed: %v\n", err)
+			}
+		case <-fw.stopped:
+			return
+		}
+	}
+}
+
+func (fw *fileWriter) replaceAndRotate() {
 	os.MkdirAll(fw.dir, 0755)
-	name := filepath.Join(fw.dir, fw.file) + "-" + time.Now().Format(fileTimeLayout)
-	fp, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY, 0644)
+
+	if fw.signalReopen {
+		// The active file lives at the stable activePath; move it aside
+		// under a rotation timestamp first so archive() picks it up like
+		// any other rotated file, freeing the stable path for the new
+		// active file.
+		rotated := filepath.Join(fw.dir, fw.file) + fw.delim() + time.Now().Format(fileTimeLayout)
+		os.Rename(fw.activePath(), rotated)
+	}
+
+	fp, err := os.OpenFile(fw.activePath(), os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		time.Sleep(10 * time.Second) // retry intv
-		return
+		return // keep writing to the current file, retried on the next rotation
 	}
 
-	old := fw.fp.Load()
-	atomic.StoreInt64(&fw.wn, 0)
-	fw.fp.Store(fp)
+	old := fw.fp
+	fw.wn = 0
+	fw.curLines = 0
+	fw.fp = fp
 	if old != os.Stdout {
-		time.Sleep(10 * time.Second)
 		old.Close()
 	}
 
@@ -161,37 +588,122 @@ func (fw *fileWriter) rotate() {
 	}
 }
 
+// archivedFile is an archived log file found under fw.archiveDir,
+// regardless of the subdirectory layout in use.
+type archivedFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// remove prunes archived log files: first by age (WithRotateDays /
+// WithRotateHours), then by count and total size (WithMaxBackups /
+// WithMaxTotalSize), oldest first. Subdirectories left empty by the
+// pruning are removed too.
 func (fw *fileWriter) remove() {
-	entries, err := os.ReadDir(fw.archiveDir)
-	if err != nil {
+	files := fw.listArchivedFiles()
+	if len(files) == 0 {
 		return
 	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
 
 	now := time.Now()
-	for _, entry := range entries {
-		if !entry.IsDir() {
+	kept := files[:0]
+	for _, f := range files {
+		if fw.expired(f.modTime, now) {
+			os.Remove(f.path)
 			continue
 		}
-		name := entry.Name()
-		if len(name) != len(archiveDateLayout) {
-			continue
+		kept = append(kept, f)
+	}
+	files = kept
+
+	if fw.maxBackups > 0 {
+		for len(files) > fw.maxBackups {
+			os.Remove(files[0].path)
+			files = files[1:]
 		}
-		date, err := time.Parse(archiveDateLayout, name)
+	}
+
+	if fw.maxTotalSize > 0 {
+		var total int64
+		for _, f := range files {
+			total += f.size
+		}
+		for len(files) > 0 && total > fw.maxTotalSize {
+			total -= files[0].size
+			os.Remove(files[0].path)
+			files = files[1:]
+		}
+	}
+
+	fw.removeEmptyArchiveDirs()
+}
+
+// expired reports whether an archived file's mtime is past the configured
+// retention (WithRotateDays in Daily mode, WithRotateHours in Hourly mode).
+// A non-positive retention disables age-based pruning.
+func (fw *fileWriter) expired(modTime, now time.Time) bool {
+	if fw.rotateInterval == Hourly {
+		if fw.rotateHours <= 0 {
+			return false
+		}
+		return now.Sub(modTime) > time.Duration(fw.rotateHours)*time.Hour
+	}
+	if fw.rotateDays <= 0 {
+		return false
+	}
+	return now.Sub(modTime) > time.Duration(fw.rotateDays)*24*time.Hour
+}
+
+func (fw *fileWriter) listArchivedFiles() []archivedFile {
+	var files []archivedFile
+	filepath.WalkDir(fw.archiveDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
 		if err != nil {
-			continue
+			return nil
 		}
+		files = append(files, archivedFile{path: path, modTime: info.ModTime(), size: info.Size()})
+		return nil
+	})
+	return files
+}
 
-		days := (now.Unix() - date.Unix()) / (24 * 3600)
-		if days <= int64(fw.rotateDays) {
+// removeEmptyArchiveDirs prunes directories left empty under
+// fw.archiveDir, walking bottom-up so a nested WithArchiveLayout (e.g.
+// "year/month/day/file") doesn't leave orphaned intermediate directories
+// behind once their files age out. fw.archiveDir itself is never removed.
+func (fw *fileWriter) removeEmptyArchiveDirs() {
+	fw.removeEmptyDir(fw.archiveDir, false)
+}
+
+// removeEmptyDir recurses into dir's subdirectories first, then removes
+// dir itself if it ended up empty and removeSelf is set. It reports
+// whether dir was removed, so a parent call knows not to count a pruned
+// child against its own emptiness.
+func (fw *fileWriter) removeEmptyDir(dir string, removeSelf bool) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	empty := true
+	for _, entry := range entries {
+		if entry.IsDir() && fw.removeEmptyDir(filepath.Join(dir, entry.Name()), true) {
 			continue
 		}
-
-		fw.removeArchive(name)
+		empty = false
 	}
+	return empty && removeSelf && os.Remove(dir) == nil
 }
 
-func (fw *fileWriter) removeArchive(dir string) {
-	os.RemoveAll(filepath.Join(fw.archiveDir, dir))
+// rotatedFileRe matches a file that New/replaceAndRotate left behind in
+// fw.dir once it stops being the active log file, e.g. "filename-20060102-150405".
+func (fw *fileWriter) rotatedFileRe() *regexp.Regexp {
+	pattern := "^" + regexp.QuoteMeta(fw.file+fw.delim()) + `\d{8}-\d{6}$`
+	return regexp.MustCompile(pattern)
 }
 
 func (fw *fileWriter) archive() {
@@ -200,18 +712,16 @@ func (fw *fileWriter) archive() {
 		return
 	}
 
+	re := fw.rotatedFileRe()
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
 		}
 		name := filepath.Base(entry.Name())
-		if len(name) != len(fw.file)+1+len(fileTimeLayout) { // "filename-20060102-150405"
-			continue
-		}
-		if !strings.HasPrefix(name, fw.file+"-") {
+		if !re.MatchString(name) {
 			continue
 		}
-		t, err := time.Parse(fileTimeLayout, name[len(name)-15:])
+		t, err := time.Parse(fileTimeLayout, name[len(name)-len(fileTimeLayout):])
 		if err != nil {
 			continue
 		}
@@ -219,45 +729,54 @@ func (fw *fileWriter) archive() {
 	}
 }
 
+// archivePath returns the path, relative to fw.archiveDir, that a log file
+// rotated at t should be moved to.
+func (fw *fileWriter) archivePath(t time.Time) string {
+	if fw.archivePathFn != nil {
+		return fw.archivePathFn(fw.file, t)
+	}
+	return filepath.Join(t.Format(fw.archiveDirLayout()), fw.file+fw.delim()+t.Format(fileTimeLayout))
+}
+
 func (fw *fileWriter) archiveFile(name string, t time.Time) {
 	var opened string
-	if fp := fw.fp.Load(); fp != nil {
-		opened = filepath.Base(fp.Name())
+	if fw.fp != nil {
+		opened = filepath.Base(fw.fp.Name())
 	}
 	if name == opened {
 		return
 	}
 
-	archiveDir := filepath.Join(fw.archiveDir, t.Format(archiveDateLayout))
-	err := os.MkdirAll(archiveDir, 0755)
+	archiveFile := filepath.Join(fw.archiveDir, fw.archivePath(t))
+	err := os.MkdirAll(filepath.Dir(archiveFile), 0755)
 	if err != nil {
 		return
 	}
 
 	originFile := filepath.Join(fw.dir, name)
-	archiveFile := filepath.Join(archiveDir, name)
 
-	if !fw.compress {
+	if fw.codec == nil {
 		os.Rename(originFile, archiveFile)
 		return
 	}
 
-	// gzip compress
-
 	src, err := os.Open(originFile)
 	if err != nil {
 		return
 	}
 	defer src.Close()
 
-	archiveFile += ".gz"
+	archiveFile += fw.codec.Extension()
 	dst, err := os.OpenFile(archiveFile, os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return
 	}
 	defer dst.Close()
 
-	w := gzip.NewWriter(dst)
+	w, err := fw.codec.NewWriter(dst)
+	if err != nil {
+		return
+	}
 	defer w.Close()
 
 	_, err = io.Copy(w, src)
@@ -274,9 +793,15 @@ func untilTommorrow() time.Duration {
 	return tommorrow.Sub(now)
 }
 
-func (fw *fileWriter) autoReplaceFileEveryday() {
-	for {
-		time.Sleep(untilTommorrow())
-		fw.replaceAndRotate()
+func untilNextHour() time.Duration {
+	now := time.Now()
+	nextHour := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location()).Add(time.Hour)
+	return nextHour.Sub(now)
+}
+
+func (fw *fileWriter) untilNextRotate() time.Duration {
+	if fw.rotateInterval == Hourly {
+		return untilNextHour()
 	}
+	return untilTommorrow()
 }